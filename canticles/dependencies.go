@@ -0,0 +1,100 @@
+package canticles
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// DependencyFile is the name Canticle saves and loads its dependency
+// manifest as, rooted at a package's source directory.
+const DependencyFile = "Canticle.deps.json"
+
+// ErrDirtyWorkingTree is returned by CaptureDependency when the VCS being
+// captured reports uncommitted changes or untracked files and allowDirty
+// was not set. Recording a dependency from a dirty tree would pin a
+// revision that doesn't actually reflect what's checked out, so Canticle
+// refuses unless the caller explicitly opts in (the CLI's -allow-dirty
+// flag).
+var ErrDirtyWorkingTree = errors.New("canticles: refusing to record a dependency from a dirty working tree (use -allow-dirty to override)")
+
+// CanticleDependency records everything Canticle knows about a single
+// dependency: where its import path root is, where its source can be
+// found, and, once captured, the revision and commit time it was pinned
+// at.
+//
+// SourcePath is the original scalar form of a dependency's source and
+// remains fully supported. SourcePaths is an optional list of candidate
+// sources (e.g. an ssh remote, an https mirror) tried in order until one
+// resolves; a dependency file may set either, but need not set both.
+type CanticleDependency struct {
+	Root        string
+	SourcePath  string   `json:",omitempty"`
+	SourcePaths []string `json:",omitempty"`
+	Revision    string   `json:",omitempty"`
+	CommitTime  string   `json:",omitempty"`
+}
+
+// Sources returns the candidate source URLs for the dependency, in the
+// order they should be tried: SourcePaths when set, falling back to the
+// single SourcePath for dependency files written before multiple sources
+// were supported.
+func (d *CanticleDependency) Sources() []string {
+	if len(d.SourcePaths) > 0 {
+		return d.SourcePaths
+	}
+	if d.SourcePath != "" {
+		return []string{d.SourcePath}
+	}
+	return nil
+}
+
+// CaptureDependency builds the CanticleDependency for root/sourcePath from
+// v's current Status, refusing to do so if v's working tree is dirty
+// unless allowDirty is true.
+func CaptureDependency(root, sourcePath string, v VCS, allowDirty bool) (*CanticleDependency, error) {
+	status, err := v.Status()
+	if err != nil {
+		return nil, err
+	}
+	if !allowDirty && status.Dirty() {
+		return nil, ErrDirtyWorkingTree
+	}
+	return &CanticleDependency{
+		Root:       root,
+		SourcePath: sourcePath,
+		Revision:   status.Revision,
+		CommitTime: status.CommitTime,
+	}, nil
+}
+
+// Dependencies is the full set of dependencies tracked for a package,
+// keyed by import path root.
+type Dependencies map[string]*CanticleDependency
+
+// ReadDependencyFile loads the Dependencies recorded at path. A missing
+// file is treated as an empty dependency set.
+func ReadDependencyFile(path string) (Dependencies, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Dependencies{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	deps := Dependencies{}
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// WriteDependencyFile saves deps to path as indented JSON.
+func WriteDependencyFile(path string, deps Dependencies) error {
+	data, err := json.MarshalIndent(deps, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
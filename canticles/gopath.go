@@ -0,0 +1,30 @@
+package canticles
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrNoGoPath is returned when the GOPATH environment variable is unset or
+// empty.
+var ErrNoGoPath = errors.New("GOPATH environment variable is not set")
+
+// EnvGoPath returns the first entry of the GOPATH environment variable. If
+// GOPATH contains multiple entries (separated by filepath.ListSeparator)
+// only the first is considered, matching the behavior of the go tool for
+// write operations.
+func EnvGoPath() (string, error) {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return "", ErrNoGoPath
+	}
+	return filepath.SplitList(gopath)[0], nil
+}
+
+// PackageSource returns the path to the source of the package pkg rooted
+// at gopath, i.e. $GOPATH/src/pkg.
+func PackageSource(gopath, pkg string) string {
+	return path.Join(gopath, "src", pkg)
+}
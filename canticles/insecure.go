@@ -0,0 +1,106 @@
+package canticles
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// secureSchemes lists the URL schemes RemoteRepoResolver and
+// DefaultRepoResolver will accept without the import path root being
+// explicitly allowlisted in InsecureHosts.
+var secureSchemes = map[string]bool{
+	"https":   true,
+	"git+ssh": true,
+	"bzr+ssh": true,
+	"svn+ssh": true,
+	"ssh":     true,
+}
+
+// InsecureHosts is the allowlist of import path root patterns permitted
+// to resolve over an insecure scheme. Patterns are matched segment by
+// segment against the "/"-separated root, with a trailing "*" segment
+// (e.g. "github.com/*") matching the rest of the path regardless of how
+// many segments remain, since plain path.Match never matches across "/"
+// and so can't express that. It is seeded from the CANTICLE_INSECURE
+// environment variable (a comma separated list of patterns) and is also
+// where the CLI's -insecure-hosts flag appends its patterns.
+var InsecureHosts []string
+
+func init() {
+	if v := os.Getenv("CANTICLE_INSECURE"); v != "" {
+		InsecureHosts = strings.Split(v, ",")
+	}
+}
+
+// InsecureProtocolError is returned when a resolver would otherwise
+// return a repository reached over a scheme outside secureSchemes and
+// root isn't allowlisted in InsecureHosts. CompositeRepoResolver treats
+// this as a policy failure rather than a "not found" and stops trying
+// further resolvers, since no other resolver is any more entitled to
+// bypass the policy.
+type InsecureProtocolError struct {
+	Root   string
+	Scheme string
+}
+
+func (e *InsecureProtocolError) Error() string {
+	return fmt.Sprintf("canticles: refusing to use insecure scheme %q for %s (allow it with -insecure-hosts or CANTICLE_INSECURE)", e.Scheme, e.Root)
+}
+
+// isInsecureAllowed reports whether root matches one of the InsecureHosts
+// patterns.
+func isInsecureAllowed(root string) bool {
+	for _, pattern := range InsecureHosts {
+		if matchRootPattern(pattern, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRootPattern reports whether pattern matches root, comparing one
+// "/"-separated segment at a time with path.Match. A pattern segment of
+// "*" in the final position matches every remaining segment of root, so
+// "github.com/*" matches "github.com/Comcast/Canticle" the way a caller
+// writing that pattern would expect.
+func matchRootPattern(pattern, root string) bool {
+	patSegs := strings.Split(pattern, "/")
+	rootSegs := strings.Split(root, "/")
+	for i, seg := range patSegs {
+		if seg == "*" && i == len(patSegs)-1 {
+			return true
+		}
+		if i >= len(rootSegs) {
+			return false
+		}
+		if ok, _ := path.Match(seg, rootSegs[i]); !ok {
+			return false
+		}
+	}
+	return len(patSegs) == len(rootSegs)
+}
+
+// checkScheme validates that repo is reached over a secure scheme, or
+// that root is allowlisted to bypass that check, returning an
+// InsecureProtocolError otherwise. A repo with no explicit scheme (e.g.
+// git's "user@host:path" syntax) is treated as secure, since it is
+// inherently ssh.
+func checkScheme(root, repo string) error {
+	scheme := urlScheme(repo)
+	if scheme == "" || secureSchemes[scheme] {
+		return nil
+	}
+	if isInsecureAllowed(root) {
+		return nil
+	}
+	return &InsecureProtocolError{Root: root, Scheme: scheme}
+}
+
+func urlScheme(repo string) string {
+	if i := strings.Index(repo, "://"); i >= 0 {
+		return repo[:i]
+	}
+	return ""
+}
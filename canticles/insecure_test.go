@@ -0,0 +1,69 @@
+package canticles
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckScheme(t *testing.T) {
+	defer func() { InsecureHosts = nil }()
+
+	if err := checkScheme("github.com/Comcast/Canticle", "https://github.com/Comcast/Canticle.git"); err != nil {
+		t.Errorf("checkScheme rejected a secure https scheme: %s", err.Error())
+	}
+	if err := checkScheme("github.com/Comcast/Canticle", "git@github.com:Comcast/Canticle.git"); err != nil {
+		t.Errorf("checkScheme rejected a schemeless (ssh) source: %s", err.Error())
+	}
+	if err := checkScheme("github.com/Comcast/Canticle", "git://github.com/Comcast/Canticle.git"); err == nil {
+		t.Errorf("checkScheme accepted an insecure git:// scheme")
+	}
+
+	InsecureHosts = []string{"github.com/*"}
+	if err := checkScheme("github.com/Comcast/Canticle", "git://github.com/Comcast/Canticle.git"); err != nil {
+		t.Errorf("checkScheme rejected an allowlisted insecure scheme: %s", err.Error())
+	}
+	if err := checkScheme("example.com/other", "git://example.com/other.git"); err == nil {
+		t.Errorf("checkScheme allowed an insecure scheme for a host not in the allowlist")
+	}
+}
+
+func TestRemoteRepoResolverRejectsInsecureScheme(t *testing.T) {
+	defer func() { InsecureHosts = nil }()
+
+	rr := &RemoteRepoResolver{os.ExpandEnv("$GOPATH")}
+	dep := &CanticleDependency{
+		Root:       "github.com/Comcast/Canticle",
+		SourcePath: "git://github.com/Comcast/Canticle.git",
+	}
+
+	_, err := rr.ResolveRepo(dep.Root, dep)
+	ipe, ok := err.(*InsecureProtocolError)
+	if !ok {
+		t.Fatalf("RemoteRepoResolver did not reject an insecure scheme, got err %v", err)
+	}
+	if ipe.Scheme != "git" {
+		t.Errorf("InsecureProtocolError has wrong scheme %s", ipe.Scheme)
+	}
+
+	InsecureHosts = []string{"github.com/*"}
+	if _, err := rr.ResolveRepo(dep.Root, dep); err != nil {
+		if _, ok := err.(*InsecureProtocolError); ok {
+			t.Errorf("RemoteRepoResolver still rejected an allowlisted insecure scheme")
+		}
+	}
+}
+
+func TestCompositeRepoResolverStopsOnInsecureProtocolError(t *testing.T) {
+	insecure := &testResolver{response: []resolve{{nil, &InsecureProtocolError{Root: "testi", Scheme: "git"}}}}
+	fallback := &testResolver{response: []resolve{{&TestVCS{}, nil}}}
+	cr := &CompositeRepoResolver{Resolvers: []RepoResolver{insecure, fallback}}
+
+	dep := &CanticleDependency{Root: "testi"}
+	_, err := cr.ResolveRepo(dep.Root, dep)
+	if _, ok := err.(*InsecureProtocolError); !ok {
+		t.Errorf("CompositeRepoResolver did not surface the InsecureProtocolError, got %v", err)
+	}
+	if len(fallback.resolutions) != 0 {
+		t.Errorf("CompositeRepoResolver tried another resolver after an InsecureProtocolError")
+	}
+}
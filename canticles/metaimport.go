@@ -0,0 +1,203 @@
+package canticles
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// MetaImport describes a <meta name="go-import"> tag discovered while
+// probing an import path for its canonical VCS location: the path prefix
+// it applies to, the VCS tool to use, and the repository root to fetch
+// from. It matches the three-field "prefix vcs repo" content Go's own
+// internal/vcs/discovery.go looks for.
+type MetaImport struct {
+	Prefix   string
+	VCS      string
+	RepoRoot string
+}
+
+// GoSource describes a <meta name="go-source"> tag, which links
+// documentation browsers directly to source without needing a checkout.
+type GoSource struct {
+	Prefix    string
+	Home      string
+	Directory string
+	File      string
+}
+
+var (
+	metaCacheMu sync.Mutex
+	metaCache   = map[string]*metaResult{}
+)
+
+type metaResult struct {
+	imp *MetaImport
+	src *GoSource
+	err error
+}
+
+// DiscoverMeta fetches https://{importPath}?go-get=1 and extracts the
+// go-import (and, if present, go-source) meta tags that apply to
+// importPath, caching the result so repeated lookups for the same import
+// path don't refetch the page.
+func DiscoverMeta(importPath string) (*MetaImport, *GoSource, error) {
+	metaCacheMu.Lock()
+	if res, ok := metaCache[importPath]; ok {
+		metaCacheMu.Unlock()
+		return res.imp, res.src, res.err
+	}
+	metaCacheMu.Unlock()
+
+	imp, src, err := discoverMeta(importPath)
+
+	metaCacheMu.Lock()
+	metaCache[importPath] = &metaResult{imp, src, err}
+	metaCacheMu.Unlock()
+
+	return imp, src, err
+}
+
+func discoverMeta(importPath string) (*MetaImport, *GoSource, error) {
+	url := "https://" + importPath + "?go-get=1"
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("canticles: could not fetch %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("canticles: %s returned status %s", url, resp.Status)
+	}
+
+	imports, sources, err := parseMetaGoImports(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	imp, err := matchMetaImport(importPath, imports)
+	if err != nil {
+		return nil, nil, err
+	}
+	return imp, matchGoSource(imp.Prefix, sources), nil
+}
+
+// charsetReader restricts the XML decoder to UTF-8 (which encoding/xml
+// already handles without calling this) and plain ASCII, returning a
+// clear error for anything else so callers know why a go-get=1 page
+// couldn't be parsed, rather than failing with an opaque XML error.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "ascii":
+		return input, nil
+	default:
+		return nil, fmt.Errorf("canticles: cannot decode go-get=1 page using charset %q (only UTF-8/ASCII are supported)", charset)
+	}
+}
+
+// parseMetaGoImports extracts go-import and go-source meta tags from the
+// HTML in r. Parsing ends at the end of the <head> section or the
+// beginning of the <body>, mirroring Go's own discovery rules.
+func parseMetaGoImports(r io.Reader) (imports []MetaImport, sources []GoSource, err error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.CharsetReader = charsetReader
+
+	for {
+		var t xml.Token
+		t, err = d.RawToken()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		switch attrValue(e.Attr, "name") {
+		case "go-import":
+			if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+				imports = append(imports, MetaImport{Prefix: f[0], VCS: f[1], RepoRoot: f[2]})
+			}
+		case "go-source":
+			if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 4 {
+				sources = append(sources, GoSource{Prefix: f[0], Home: f[1], Directory: f[2], File: f[3]})
+			}
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// matchMetaImport returns the go-import meta tag whose Prefix is the
+// longest path prefix of importPath (see isPathPrefix; importPath itself
+// counts), erroring if none match.
+func matchMetaImport(importPath string, imports []MetaImport) (*MetaImport, error) {
+	var best *MetaImport
+	for i := range imports {
+		imp := imports[i]
+		if !isPathPrefix(importPath, imp.Prefix) {
+			continue
+		}
+		if best == nil || len(imp.Prefix) > len(best.Prefix) {
+			best = &imp
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("canticles: no go-import meta tag for %s matched a prefix of the import path", importPath)
+	}
+	return best, nil
+}
+
+// matchGoSource returns the go-source meta tag for prefix, if any.
+func matchGoSource(prefix string, sources []GoSource) *GoSource {
+	for i := range sources {
+		if sources[i].Prefix == prefix {
+			return &sources[i]
+		}
+	}
+	return nil
+}
+
+// isPathPrefix reports whether prefix is importPath itself or a path
+// segment prefix of it (so "example.com/foo" matches "example.com/foo/bar"
+// but not "example.com/foobar").
+func isPathPrefix(importPath, prefix string) bool {
+	if !strings.HasPrefix(importPath, prefix) {
+		return false
+	}
+	return len(importPath) == len(prefix) || importPath[len(prefix)] == '/'
+}
+
+// metaRepoRoot discovers importPath via DiscoverMeta and turns the result
+// into a vcs.RepoRoot, the same shape vcs.RepoRootForImportPath produces,
+// so DefaultRepoResolver can fall back to it when that lookup fails.
+func metaRepoRoot(importPath string) (*vcs.RepoRoot, error) {
+	imp, _, err := DiscoverMeta(importPath)
+	if err != nil {
+		return nil, err
+	}
+	cmd := vcs.ByCmd(imp.VCS)
+	if cmd == nil {
+		return nil, fmt.Errorf("canticles: go-import meta tag for %s named unsupported VCS %q", imp.Prefix, imp.VCS)
+	}
+	return &vcs.RepoRoot{VCS: cmd, Repo: imp.RepoRoot, Root: imp.Prefix}, nil
+}
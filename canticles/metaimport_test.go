@@ -0,0 +1,118 @@
+package canticles
+
+import (
+	"os"
+	"testing"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Error opening fixture %s: %s", name, err.Error())
+	}
+	return f
+}
+
+func TestParseMetaGoImportsMultiMeta(t *testing.T) {
+	f := openFixture(t, "multi-meta.html")
+	defer f.Close()
+
+	imports, sources, err := parseMetaGoImports(f)
+	if err != nil {
+		t.Fatalf("parseMetaGoImports returned error: %s", err.Error())
+	}
+	if len(imports) != 2 {
+		t.Fatalf("parseMetaGoImports returned %d imports, expected 2", len(imports))
+	}
+	if len(sources) != 2 {
+		t.Fatalf("parseMetaGoImports returned %d sources, expected 2", len(sources))
+	}
+
+	imp, err := matchMetaImport("example.com/foo/bar/baz", imports)
+	if err != nil {
+		t.Fatalf("matchMetaImport returned error: %s", err.Error())
+	}
+	if imp.Prefix != "example.com/foo/bar" {
+		t.Errorf("matchMetaImport did not prefer the longest prefix, got %s", imp.Prefix)
+	}
+	if imp.RepoRoot != "https://example.com/foo-bar.git" {
+		t.Errorf("matchMetaImport returned wrong RepoRoot %s", imp.RepoRoot)
+	}
+
+	src := matchGoSource(imp.Prefix, sources)
+	if src == nil {
+		t.Fatalf("matchGoSource did not find a go-source entry for %s", imp.Prefix)
+	}
+	if src.Directory != "https://example.com/foo-bar/tree/master{/dir}" {
+		t.Errorf("matchGoSource returned wrong Directory %s", src.Directory)
+	}
+}
+
+func TestParseMetaGoImportsPrefixMismatch(t *testing.T) {
+	f := openFixture(t, "prefix-mismatch.html")
+	defer f.Close()
+
+	imports, _, err := parseMetaGoImports(f)
+	if err != nil {
+		t.Fatalf("parseMetaGoImports returned error: %s", err.Error())
+	}
+
+	if _, err := matchMetaImport("example.com/foo", imports); err == nil {
+		t.Errorf("matchMetaImport did not reject a go-import tag whose prefix does not match the import path")
+	}
+}
+
+func TestParseMetaGoImportsRejectsNonASCIICharset(t *testing.T) {
+	f := openFixture(t, "charset-reject.html")
+	defer f.Close()
+
+	_, _, err := parseMetaGoImports(f)
+	if err == nil {
+		t.Fatalf("parseMetaGoImports did not reject a non-ASCII/UTF-8 charset")
+	}
+}
+
+func TestDefaultRepoResolverFallsBackToMeta(t *testing.T) {
+	importPath := "example.com/nonexistent-metaimport-fallback-test/sub"
+
+	metaCacheMu.Lock()
+	metaCache[importPath] = &metaResult{
+		imp: &MetaImport{Prefix: "example.com/nonexistent-metaimport-fallback-test", VCS: "git", RepoRoot: "https://example.com/fallback.git"},
+	}
+	metaCacheMu.Unlock()
+	defer func() {
+		metaCacheMu.Lock()
+		delete(metaCache, importPath)
+		metaCacheMu.Unlock()
+	}()
+
+	dr := &DefaultRepoResolver{}
+	v, err := dr.ResolveRepo(importPath, nil)
+	if err != nil {
+		t.Fatalf("DefaultRepoResolver did not fall back to meta discovery: %s", err.Error())
+	}
+	pv := v.(*PackageVCS)
+	if pv.Repo.Root != "example.com/nonexistent-metaimport-fallback-test" {
+		t.Errorf("DefaultRepoResolver meta fallback set wrong Root, got %s", pv.Repo.Root)
+	}
+	if pv.Repo.Repo != "https://example.com/fallback.git" {
+		t.Errorf("DefaultRepoResolver meta fallback set wrong Repo, got %s", pv.Repo.Repo)
+	}
+}
+
+func TestIsPathPrefix(t *testing.T) {
+	cases := []struct {
+		importPath, prefix string
+		want               bool
+	}{
+		{"example.com/foo", "example.com/foo", true},
+		{"example.com/foo/bar", "example.com/foo", true},
+		{"example.com/foobar", "example.com/foo", false},
+		{"example.com/foo", "example.com/foo/bar", false},
+	}
+	for _, c := range cases {
+		if got := isPathPrefix(c.importPath, c.prefix); got != c.want {
+			t.Errorf("isPathPrefix(%q, %q) = %v, want %v", c.importPath, c.prefix, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package canticles
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/tools/go/vcs"
+)
+
+// RepoResolver turns an import path (and, where known, the
+// CanticleDependency recorded for it) into a VCS Canticle can operate on.
+type RepoResolver interface {
+	ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error)
+}
+
+// resolve pairs a VCS resolution with its error, so it can be cached,
+// queued, or passed across goroutines as a single value.
+type resolve struct {
+	v   VCS
+	err error
+}
+
+// resolutionFailureErr is returned by CompositeRepoResolver when every
+// RepoResolver it tried failed.
+type resolutionFailureErr struct {
+	importPath string
+	errs       []error
+}
+
+func (e *resolutionFailureErr) Error() string {
+	return fmt.Sprintf("canticles: no resolver could resolve %s: %v", e.importPath, e.errs)
+}
+
+// ResolutionFailureErr returns err's underlying resolution failure details
+// if err (or something it wraps) came from a CompositeRepoResolver that
+// exhausted every candidate resolver, and nil otherwise.
+func ResolutionFailureErr(err error) error {
+	var rf *resolutionFailureErr
+	if errors.As(err, &rf) {
+		return rf
+	}
+	return nil
+}
+
+// DefaultRepoResolver resolves an import path using the same go-get style
+// discovery the go tool itself uses, ignoring any recorded dependency
+// metadata. If that discovery fails, it falls back to Canticle's own
+// go-import/go-source meta tag discovery (DiscoverMeta), which covers
+// hosts or page shapes golang.org/x/tools/go/vcs doesn't recognize.
+type DefaultRepoResolver struct {
+	GoPath string
+}
+
+func (d *DefaultRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	repo, err := vcs.RepoRootForImportPath(importPath, true)
+	if err != nil {
+		repo, err = metaRepoRoot(importPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkScheme(repo.Root, repo.Repo); err != nil {
+		return nil, err
+	}
+	return &PackageVCS{Repo: repo, GoPath: d.GoPath}, nil
+}
+
+// RequiresNetwork reports that DefaultRepoResolver always needs the
+// network, so CompositeRepoResolver skips it when Offline is set.
+func (d *DefaultRepoResolver) RequiresNetwork() bool { return true }
+
+// RemoteRepoResolver resolves a dependency using the source(s) recorded
+// for it (CanticleDependency.Sources), bypassing go-get discovery
+// entirely. It requires dep to be non-nil and carry at least one source,
+// and confirms a source is actually reachable (in the order given) before
+// returning it, recording whichever one worked in the returned
+// PackageVCS.
+type RemoteRepoResolver struct {
+	GoPath string
+}
+
+func (r *RemoteRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	if dep == nil {
+		return nil, fmt.Errorf("canticles: RemoteRepoResolver requires at least one recorded source to resolve %s", importPath)
+	}
+	sources := dep.Sources()
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("canticles: RemoteRepoResolver requires at least one recorded source to resolve %s", importPath)
+	}
+	root := dep.Root
+	if root == "" {
+		root = importPath
+	}
+
+	var errs []error
+	var insecure *InsecureProtocolError
+	for _, source := range sources {
+		if err := checkScheme(root, source); err != nil {
+			if ipe, ok := err.(*InsecureProtocolError); ok && insecure == nil {
+				insecure = ipe
+			}
+			errs = append(errs, err)
+			continue
+		}
+		cmd, err := vcsForSourcePath(source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if out, err := exec.Command(cmd.Cmd, "ls-remote", source).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("canticles: could not reach %s: %s: %s", source, err, out))
+			continue
+		}
+		return &PackageVCS{
+			Repo:   &vcs.RepoRoot{VCS: cmd, Repo: source, Root: root},
+			GoPath: r.GoPath,
+		}, nil
+	}
+	if insecure != nil {
+		return nil, insecure
+	}
+	return nil, fmt.Errorf("canticles: could not reach any source for %s: %v", importPath, errs)
+}
+
+// RequiresNetwork reports that RemoteRepoResolver always needs the
+// network, so CompositeRepoResolver skips it when Offline is set.
+func (r *RemoteRepoResolver) RequiresNetwork() bool { return true }
+
+// vcsForSourcePath guesses the VCS command backing a dependency's recorded
+// SourcePath. Canticle dependencies are overwhelmingly git today, so that
+// is the only binding recognized; new bindings can be added here as they
+// come up.
+func vcsForSourcePath(sourcePath string) (*vcs.Cmd, error) {
+	switch {
+	case strings.HasPrefix(sourcePath, "git@") || strings.Contains(sourcePath, ".git"):
+		return vcs.ByCmd("git"), nil
+	default:
+		return nil, fmt.Errorf("canticles: could not determine VCS for source path %q", sourcePath)
+	}
+}
+
+// LocalRepoResolver resolves a dependency by inspecting an existing
+// checkout under LocalPath, without touching the network.
+type LocalRepoResolver struct {
+	LocalPath string
+}
+
+func (l *LocalRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	root, err := vcs.RepoRootForImportPath(importPath, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalVCS(importPath, root.Root, l.LocalPath, root.VCS), nil
+}
+
+// LocalFirstRepoResolver trusts an existing local checkout over the
+// network: it consults Local first, and only falls through to Remote when
+// no local checkout exists or the checkout's recorded remote disagrees
+// with dep.SourcePath (e.g. the dependency was re-pointed at a mirror).
+// This mirrors dep's "trust local source info" behavior and avoids a
+// go-get-style network probe for every dependency already on disk.
+type LocalFirstRepoResolver struct {
+	Local  RepoResolver
+	Remote RepoResolver
+	// Offline, wired up to the same -offline flag as
+	// CompositeRepoResolver.Offline, makes ResolveRepo return
+	// ErrOfflineResolutionRequired instead of consulting Remote when
+	// Local didn't produce an agreeing resolution.
+	Offline bool
+}
+
+func (l *LocalFirstRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	v, err := l.Local.ResolveRepo(importPath, dep)
+	if err == nil && localSourceAgrees(v, dep) {
+		return v, nil
+	}
+	if l.Offline {
+		return nil, ErrOfflineResolutionRequired
+	}
+	return l.Remote.ResolveRepo(importPath, dep)
+}
+
+// localSourceAgrees reports whether v's recorded source matches dep's, or
+// whether there is nothing to disagree about (no dep, no SourcePath, or v
+// doesn't know its source yet).
+func localSourceAgrees(v VCS, dep *CanticleDependency) bool {
+	if dep == nil || dep.SourcePath == "" {
+		return true
+	}
+	source, err := v.GetSource()
+	if err != nil || source == "" {
+		return true
+	}
+	return source == dep.SourcePath
+}
+
+// ErrOfflineResolutionRequired is returned by CompositeRepoResolver when
+// Offline is set and resolving importPath would require a resolver that
+// needs the network (see NetworkResolver).
+var ErrOfflineResolutionRequired = errors.New("canticles: resolution requires network access, but -offline was set")
+
+// NetworkResolver is implemented by RepoResolvers that must reach the
+// network to do their job. CompositeRepoResolver consults it to honor
+// Offline.
+type NetworkResolver interface {
+	RequiresNetwork() bool
+}
+
+// CompositeRepoResolver tries each of Resolvers in turn, returning the
+// first successful resolution. If every resolver fails it returns a
+// resolutionFailureErr, retrievable with ResolutionFailureErr.
+type CompositeRepoResolver struct {
+	Resolvers []RepoResolver
+	// Offline, wired up to the CLI's -offline flag, skips any Resolvers
+	// that require network access rather than trying them.
+	Offline bool
+}
+
+func (c *CompositeRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	var errs []error
+	skippedNetwork := false
+	for _, r := range c.Resolvers {
+		if c.Offline {
+			if nr, ok := r.(NetworkResolver); ok && nr.RequiresNetwork() {
+				skippedNetwork = true
+				continue
+			}
+		}
+		v, err := r.ResolveRepo(importPath, dep)
+		if err == nil {
+			return v, nil
+		}
+		if _, ok := err.(*InsecureProtocolError); ok {
+			// A policy failure, not a "not found": no other resolver
+			// is any more entitled to bypass it, so stop here instead
+			// of masking it behind a generic resolution failure.
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	if skippedNetwork {
+		return nil, ErrOfflineResolutionRequired
+	}
+	return nil, &resolutionFailureErr{importPath: importPath, errs: errs}
+}
+
+// MemoizedRepoResolver wraps a RepoResolver, caching each resolution so
+// repeated lookups for the same import path don't redo the underlying
+// work. Concurrent lookups sharing a key are deduplicated with a
+// singleflight.Group, so a dep graph walked across goroutines only fires
+// one underlying resolution per (root, SourcePath) regardless of how many
+// goroutines ask for it at once.
+type MemoizedRepoResolver struct {
+	Resolver RepoResolver
+	group    singleflight.Group
+	mu       sync.Mutex
+	cache    map[string]resolve
+}
+
+// NewMemoizedRepoResolver returns a MemoizedRepoResolver wrapping resolver.
+func NewMemoizedRepoResolver(resolver RepoResolver) *MemoizedRepoResolver {
+	return &MemoizedRepoResolver{
+		Resolver: resolver,
+		cache:    make(map[string]resolve),
+	}
+}
+
+// memoKey identifies a resolution by the import path and the candidate
+// sources recorded for it (CanticleDependency.Sources), since the same
+// root can resolve differently depending on which sources it was pinned
+// to.
+func memoKey(importPath string, dep *CanticleDependency) string {
+	sources := ""
+	if dep != nil {
+		sources = strings.Join(dep.Sources(), "\x00")
+	}
+	return importPath + "\x00" + sources
+}
+
+func (m *MemoizedRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	key := memoKey(importPath, dep)
+
+	m.mu.Lock()
+	if res, ok := m.cache[key]; ok {
+		m.mu.Unlock()
+		return res.v, res.err
+	}
+	m.mu.Unlock()
+
+	result, err, _ := m.group.Do(key, func() (interface{}, error) {
+		// A caller that missed the cache above may only get here after an
+		// earlier flight for key has finished; reuse its result.
+		m.mu.Lock()
+		if res, ok := m.cache[key]; ok {
+			m.mu.Unlock()
+			return res.v, res.err
+		}
+		m.mu.Unlock()
+		v, err := m.Resolver.ResolveRepo(importPath, dep)
+		m.mu.Lock()
+		m.cache[key] = resolve{v, err}
+		m.mu.Unlock()
+		return v, err
+	})
+	if result == nil {
+		return nil, err
+	}
+	return result.(VCS), err
+}
@@ -0,0 +1,255 @@
+package canticles
+
+import (
+	"golang.org/x/tools/go/vcs"
+)
+
+// VCS is the operations Canticle needs to perform against a package's
+// version control system in order to fetch, inspect, and pin a dependency
+// on disk.
+type VCS interface {
+	// Create checks out rev (the empty string for the default branch)
+	// into a fresh local copy of the repository.
+	Create(rev string) error
+	// SetRev syncs the local copy to rev.
+	SetRev(rev string) error
+	// UpdateBranch brings branch up to date, returning whether it moved
+	// and the revision it now points at.
+	UpdateBranch(branch string) (bool, string, error)
+	// GetRev returns the revision currently checked out locally.
+	GetRev() (string, error)
+	// GetSource returns the source URL the local copy was cloned from.
+	GetSource() (string, error)
+	// GetRoot returns the import path root this VCS was resolved for.
+	GetRoot() string
+	// GetBranch returns the branch currently checked out locally, or the
+	// empty string when the implementation has no way to tell.
+	GetBranch() (string, error)
+	// Status returns a structured snapshot of the local checkout's
+	// revision, commit time, and working tree cleanliness.
+	Status() (*VCSStatus, error)
+}
+
+// VCSStatus is a snapshot of a local checkout's state, suitable for
+// recording alongside a CanticleDependency so a save can be reproduced (or
+// refused) later.
+type VCSStatus struct {
+	// Revision is the revision currently checked out.
+	Revision string
+	// CommitTime is the commit time of Revision, in RFC3339.
+	CommitTime string
+	// Uncommitted is true if the working tree has modifications to
+	// tracked files that are not yet committed.
+	Uncommitted bool
+	// Untracked is true if the working tree contains files the VCS
+	// does not yet track.
+	Untracked bool
+}
+
+// Dirty reports whether status describes a working tree save should refuse
+// to record without an explicit override.
+func (s *VCSStatus) Dirty() bool {
+	return s.Uncommitted || s.Untracked
+}
+
+// LocalVCS implements VCS against a package that is already checked out
+// somewhere under a GOPATH, using a golang.org/x/tools/go/vcs.Cmd to drive
+// the underlying VCS binary and the VCSCmd entries in RevCmds to read back
+// information a plain vcs.Cmd doesn't expose.
+type LocalVCS struct {
+	// Pkg is the import path of the package itself, which may be nested
+	// below Root when Root's repository contains multiple packages.
+	Pkg string
+	// Root is the import path of the repository root.
+	Root string
+	// GoPath is the GOPATH the local copy lives under.
+	GoPath string
+	// Cmd drives the underlying VCS binary.
+	Cmd *vcs.Cmd
+	// Source is the repository URL to clone from, used by Create. It is
+	// left empty for checkouts that already exist on disk, since
+	// GetSource reads the actual configured remote instead.
+	Source string
+	// Branches, if set, lists the branches of the local checkout, the one
+	// currently checked out first; GetBranch reports that first entry. It
+	// exists primarily so tests can stub branch discovery.
+	Branches func(dir string) ([]string, error)
+}
+
+// NewLocalVCS returns a LocalVCS for the repository rooted at root
+// (import path pkg may be a sub package of root) checked out under gopath.
+func NewLocalVCS(pkg, root, gopath string, cmd *vcs.Cmd) *LocalVCS {
+	return &LocalVCS{
+		Pkg:    pkg,
+		Root:   root,
+		GoPath: gopath,
+		Cmd:    cmd,
+	}
+}
+
+// dir returns the local checkout directory for the repository root.
+func (v *LocalVCS) dir() string {
+	return PackageSource(v.GoPath, v.Root)
+}
+
+func (v *LocalVCS) Create(rev string) error {
+	if rev != "" {
+		return v.Cmd.CreateAtRev(v.dir(), v.Source, rev)
+	}
+	return v.Cmd.Create(v.dir(), v.Source)
+}
+
+func (v *LocalVCS) SetRev(rev string) error {
+	return v.Cmd.TagSync(v.dir(), rev)
+}
+
+func (v *LocalVCS) UpdateBranch(branch string) (bool, string, error) {
+	before, err := v.GetRev()
+	if err != nil {
+		return false, "", err
+	}
+	if err := v.Cmd.Download(v.dir()); err != nil {
+		return false, "", err
+	}
+	if err := v.SetRev(branch); err != nil {
+		return false, "", err
+	}
+	after, err := v.GetRev()
+	if err != nil {
+		return false, "", err
+	}
+	return before != after, after, nil
+}
+
+func (v *LocalVCS) GetRev() (string, error) {
+	revCmd, ok := RevCmds[v.Cmd.Name]
+	if !ok {
+		return "", nil
+	}
+	return revCmd.Exec(v.dir())
+}
+
+func (v *LocalVCS) GetSource() (string, error) {
+	sourceCmd, ok := SourceCmds[v.Cmd.Name]
+	if !ok {
+		return v.Source, nil
+	}
+	return sourceCmd.Exec(v.dir())
+}
+
+func (v *LocalVCS) GetRoot() string {
+	return v.Root
+}
+
+func (v *LocalVCS) GetBranch() (string, error) {
+	if v.Branches == nil {
+		return "", nil
+	}
+	branches, err := v.Branches(v.dir())
+	if err != nil {
+		return "", err
+	}
+	if len(branches) == 0 {
+		return "", nil
+	}
+	return branches[0], nil
+}
+
+func (v *LocalVCS) Status() (*VCSStatus, error) {
+	return vcsStatus(v.Cmd.Name, v.dir(), v.GetRev)
+}
+
+// PackageVCS implements VCS against a repository located purely by import
+// path resolution (golang.org/x/tools/go/vcs.RepoRoot), as returned by
+// DefaultRepoResolver and RemoteRepoResolver, combined with the GoPath the
+// package will be (or is) checked out under.
+type PackageVCS struct {
+	Repo   *vcs.RepoRoot
+	GoPath string
+}
+
+func (v *PackageVCS) dir() string {
+	return PackageSource(v.GoPath, v.Repo.Root)
+}
+
+func (v *PackageVCS) Create(rev string) error {
+	if rev != "" {
+		return v.Repo.VCS.CreateAtRev(v.dir(), v.Repo.Repo, rev)
+	}
+	return v.Repo.VCS.Create(v.dir(), v.Repo.Repo)
+}
+
+func (v *PackageVCS) SetRev(rev string) error {
+	return v.Repo.VCS.TagSync(v.dir(), rev)
+}
+
+func (v *PackageVCS) UpdateBranch(branch string) (bool, string, error) {
+	before, err := v.GetRev()
+	if err != nil {
+		return false, "", err
+	}
+	if err := v.Repo.VCS.Download(v.dir()); err != nil {
+		return false, "", err
+	}
+	if err := v.SetRev(branch); err != nil {
+		return false, "", err
+	}
+	after, err := v.GetRev()
+	if err != nil {
+		return false, "", err
+	}
+	return before != after, after, nil
+}
+
+func (v *PackageVCS) GetRev() (string, error) {
+	revCmd, ok := RevCmds[v.Repo.VCS.Name]
+	if !ok {
+		return "", nil
+	}
+	return revCmd.Exec(v.dir())
+}
+
+func (v *PackageVCS) GetSource() (string, error) {
+	return v.Repo.Repo, nil
+}
+
+func (v *PackageVCS) GetRoot() string {
+	return v.Repo.Root
+}
+
+// GetBranch always returns the empty string: PackageVCS does not inspect
+// which branch its checkout is on.
+func (v *PackageVCS) GetBranch() (string, error) {
+	return "", nil
+}
+
+func (v *PackageVCS) Status() (*VCSStatus, error) {
+	return vcsStatus(v.Repo.VCS.Name, v.dir(), v.GetRev)
+}
+
+// vcsStatus builds a VCSStatus for a checkout of the named VCS at dir,
+// shared by LocalVCS and PackageVCS. getRev supplies the revision, since
+// each caller already knows how to obtain it for itself.
+func vcsStatus(vcsName, dir string, getRev func() (string, error)) (*VCSStatus, error) {
+	rev, err := getRev()
+	if err != nil {
+		return nil, err
+	}
+	status := &VCSStatus{Revision: rev}
+	if timeCmd, ok := TimeCmds[vcsName]; ok {
+		commitTime, err := timeCmd.Exec(dir)
+		if err != nil {
+			return nil, err
+		}
+		status.CommitTime = commitTime
+	}
+	if statusCmd, ok := StatusCmds[vcsName]; ok {
+		uncommitted, untracked, err := statusCmd.Exec(dir)
+		if err != nil {
+			return nil, err
+		}
+		status.Uncommitted = uncommitted
+		status.Untracked = untracked
+	}
+	return status, nil
+}
@@ -5,8 +5,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"golang.org/x/tools/go/vcs"
 )
@@ -73,6 +77,49 @@ func TestRemoteRepoResolver(t *testing.T) {
 	}
 }
 
+func TestRemoteRepoResolverFallsBackAcrossSources(t *testing.T) {
+	rr := &RemoteRepoResolver{os.ExpandEnv("$GOPATH")}
+	dep := &CanticleDependency{
+		Root: "github.com/Comcast/Canticle",
+		SourcePaths: []string{
+			"git@nothere.comcast.com:viper-cog/cant.git",
+			"git@github.com:Comcast/Canticle.git",
+		},
+	}
+
+	vcs, err := rr.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Errorf("RemoteRepoResolver returned error despite a working fallback source: %s", err.Error())
+	}
+	if vcs == nil {
+		t.Fatalf("RemoteRepoResolver returned nil vcs for repo: %+v", dep)
+	}
+	v := vcs.(*PackageVCS)
+	expectedURL := "git@github.com:Comcast/Canticle.git"
+	if v.Repo.Repo != expectedURL {
+		t.Errorf("RemoteRepoResolver did not record which source worked, got %s expected %s", v.Repo.Repo, expectedURL)
+	}
+}
+
+func TestCanticleDependencySources(t *testing.T) {
+	dep := &CanticleDependency{SourcePath: "git@github.com:Comcast/Canticle.git"}
+	if s := dep.Sources(); len(s) != 1 || s[0] != dep.SourcePath {
+		t.Errorf("Sources did not fall back to SourcePath, got %v", s)
+	}
+
+	dep = &CanticleDependency{
+		SourcePath: "git@github.com:Comcast/Canticle.git",
+		SourcePaths: []string{
+			"https://github.com/Comcast/Canticle.git",
+			"git@github.com:Comcast/Canticle.git",
+		},
+	}
+	s := dep.Sources()
+	if len(s) != 2 || s[0] != "https://github.com/Comcast/Canticle.git" {
+		t.Errorf("Sources did not prefer SourcePaths over SourcePath, got %v", s)
+	}
+}
+
 func TestLocalRepoResolver(t *testing.T) {
 	gopath, err := EnvGoPath()
 	if err != nil {
@@ -154,12 +201,13 @@ func TestResolveRootWithNoSlash(t *testing.T) {
 }
 
 type TestVCS struct {
-	Updated int
-	Created int
-	Err     error
-	Rev     string
-	Source  string
-	Root    string
+	Updated      int
+	Created      int
+	Err          error
+	Rev          string
+	Source       string
+	Root         string
+	StatusResult *VCSStatus
 }
 
 func (v *TestVCS) UpdateBranch(branch string) (bool, string, error) {
@@ -194,6 +242,13 @@ func (v *TestVCS) GetBranch() (string, error) {
 	return v.Rev, v.Err
 }
 
+func (v *TestVCS) Status() (*VCSStatus, error) {
+	if v.StatusResult != nil {
+		return v.StatusResult, v.Err
+	}
+	return &VCSStatus{Revision: v.Rev}, v.Err
+}
+
 type testResolve struct {
 	path string
 	dep  *CanticleDependency
@@ -216,7 +271,7 @@ func TestCompositeRepoResolver(t *testing.T) {
 	tr1 := &testResolver{response: []resolve{{nil, errTest}}}
 	tr2 := &testResolver{response: []resolve{{res, nil}}}
 
-	cr := &CompositeRepoResolver{[]RepoResolver{tr1, tr2}}
+	cr := &CompositeRepoResolver{Resolvers: []RepoResolver{tr1, tr2}}
 
 	dep := &CanticleDependency{
 		Root: "testi",
@@ -240,13 +295,101 @@ func TestCompositeRepoResolver(t *testing.T) {
 
 	tr1 = &testResolver{response: []resolve{{nil, errTest}}}
 	tr2 = &testResolver{response: []resolve{{nil, errTest}}}
-	cr = &CompositeRepoResolver{[]RepoResolver{tr1, tr2}}
+	cr = &CompositeRepoResolver{Resolvers: []RepoResolver{tr1, tr2}}
 	v, err = cr.ResolveRepo(dep.Root, dep)
 	if re := ResolutionFailureErr(err); re == nil {
 		t.Errorf("CompositeRepoResolver did not return resolution failure")
 	}
 }
 
+func TestLocalFirstRepoResolver(t *testing.T) {
+	dep := &CanticleDependency{Root: "testi", SourcePath: "git@github.com:test/test.git"}
+
+	agree := &TestVCS{Rev: "local", Source: "git@github.com:test/test.git"}
+	local := &testResolver{response: []resolve{{agree, nil}}}
+	remote := &testResolver{response: []resolve{{&TestVCS{Rev: "remote"}, nil}}}
+	lf := &LocalFirstRepoResolver{Local: local, Remote: remote}
+	v, err := lf.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Fatalf("LocalFirstRepoResolver returned error: %s", err.Error())
+	}
+	if v != agree {
+		t.Errorf("LocalFirstRepoResolver did not prefer a local checkout whose source agrees")
+	}
+	if len(remote.resolutions) != 0 {
+		t.Errorf("LocalFirstRepoResolver consulted Remote despite an agreeing local checkout")
+	}
+
+	disagree := &TestVCS{Rev: "local", Source: "git@github.com:test/other.git"}
+	expected := &TestVCS{Rev: "remote"}
+	local = &testResolver{response: []resolve{{disagree, nil}}}
+	remote = &testResolver{response: []resolve{{expected, nil}}}
+	lf = &LocalFirstRepoResolver{Local: local, Remote: remote}
+	v, err = lf.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Fatalf("LocalFirstRepoResolver returned error: %s", err.Error())
+	}
+	if v != expected {
+		t.Errorf("LocalFirstRepoResolver did not fall back to Remote when the local source disagreed")
+	}
+
+	local = &testResolver{response: []resolve{{nil, errTest}}}
+	remote = &testResolver{response: []resolve{{expected, nil}}}
+	lf = &LocalFirstRepoResolver{Local: local, Remote: remote}
+	v, err = lf.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Fatalf("LocalFirstRepoResolver returned error: %s", err.Error())
+	}
+	if v != expected {
+		t.Errorf("LocalFirstRepoResolver did not fall back to Remote when no local checkout exists")
+	}
+
+	local = &testResolver{response: []resolve{{nil, errTest}}}
+	remote = &testResolver{response: []resolve{{expected, nil}}}
+	lf = &LocalFirstRepoResolver{Local: local, Remote: remote, Offline: true}
+	_, err = lf.ResolveRepo(dep.Root, dep)
+	if err != ErrOfflineResolutionRequired {
+		t.Errorf("LocalFirstRepoResolver did not return ErrOfflineResolutionRequired when Offline, got %v", err)
+	}
+	if len(remote.resolutions) != 0 {
+		t.Errorf("LocalFirstRepoResolver consulted Remote while Offline")
+	}
+}
+
+// networkResolver marks a testResolver as requiring the network, so
+// CompositeRepoResolver's Offline handling can be exercised.
+type networkResolver struct {
+	*testResolver
+}
+
+func (n *networkResolver) RequiresNetwork() bool { return true }
+
+func TestCompositeRepoResolverOffline(t *testing.T) {
+	res := &TestVCS{}
+	dep := &CanticleDependency{Root: "testi"}
+
+	local := &testResolver{response: []resolve{{nil, errTest}, {res, nil}}}
+	remote := &networkResolver{testResolver: &testResolver{response: []resolve{{res, nil}}}}
+	cr := &CompositeRepoResolver{Resolvers: []RepoResolver{local, remote}, Offline: true}
+
+	_, err := cr.ResolveRepo(dep.Root, dep)
+	if err != ErrOfflineResolutionRequired {
+		t.Errorf("CompositeRepoResolver did not return ErrOfflineResolutionRequired, got %v", err)
+	}
+	if len(remote.resolutions) != 0 {
+		t.Errorf("CompositeRepoResolver invoked a network resolver while Offline")
+	}
+
+	cr.Offline = false
+	v, err := cr.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Errorf("CompositeRepoResolver returned error with Offline false: %s", err.Error())
+	}
+	if v != res {
+		t.Errorf("CompositeRepoResolver returned wrong vcs")
+	}
+}
+
 func TestMemoizedRepoResolver(t *testing.T) {
 	res := &TestVCS{}
 	tr1 := &testResolver{response: []resolve{{res, nil}}}
@@ -277,6 +420,53 @@ func TestMemoizedRepoResolver(t *testing.T) {
 	}
 }
 
+// slowResolver simulates a RepoResolver backed by a real network probe:
+// it counts calls and sleeps before returning, so tests can assert how
+// many times it was actually invoked under concurrent load.
+type slowResolver struct {
+	calls int32
+	delay time.Duration
+	v     VCS
+	err   error
+}
+
+func (s *slowResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	atomic.AddInt32(&s.calls, 1)
+	time.Sleep(s.delay)
+	return s.v, s.err
+}
+
+func TestMemoizedRepoResolverDedupesConcurrentCalls(t *testing.T) {
+	res := &TestVCS{Rev: "deadbeef"}
+	sr := &slowResolver{delay: 50 * time.Millisecond, v: res}
+	mr := NewMemoizedRepoResolver(sr)
+	dep := &CanticleDependency{Root: "testi", SourcePath: "git@github.com:test/test.git"}
+
+	var wg sync.WaitGroup
+	results := make([]VCS, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := mr.ResolveRepo(dep.Root, dep)
+			if err != nil {
+				t.Errorf("MemoizedRepoResolver returned error: %s", err.Error())
+			}
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&sr.calls); calls != 1 {
+		t.Errorf("MemoizedRepoResolver made %d calls to the underlying resolver, expected 1", calls)
+	}
+	for i, v := range results {
+		if v != res {
+			t.Errorf("result %d returned wrong vcs", i)
+		}
+	}
+}
+
 var (
 	expectedRev = "testrev"
 	TestRevCmd  = &VCSCmd{
@@ -323,6 +513,50 @@ func TestVCSCmds(t *testing.T) {
 	TestRevCmd.Args = []string{expectedRev}
 }
 
+func TestStatusCmd(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+
+	cases := []struct {
+		name            string
+		statusCmd       *StatusCmd
+		output          string
+		wantUncommitted bool
+		wantUntracked   bool
+	}{
+		{"git clean", StatusCmds["Git"], "", false, false},
+		{"git uncommitted", StatusCmds["Git"], " M modified.go", true, false},
+		{"git untracked", StatusCmds["Git"], "?? newfile.go", false, true},
+		{"git uncommitted and untracked", StatusCmds["Git"], " M modified.go\n?? newfile.go", true, true},
+		{"hg clean", StatusCmds["Mercurial"], "", false, false},
+		{"hg uncommitted", StatusCmds["Mercurial"], "M modified.go", true, false},
+		{"hg untracked", StatusCmds["Mercurial"], "? newfile.go", false, true},
+	}
+	for _, c := range cases {
+		fake := &StatusCmd{
+			Name:        c.statusCmd.Name,
+			Cmd:         "echo",
+			Args:        []string{c.output},
+			Untracked:   c.statusCmd.Untracked,
+			Uncommitted: c.statusCmd.Uncommitted,
+		}
+		uncommitted, untracked, err := fake.Exec(testHome)
+		if err != nil {
+			t.Errorf("%s: Exec returned error: %s", c.name, err.Error())
+			continue
+		}
+		if uncommitted != c.wantUncommitted {
+			t.Errorf("%s: Exec returned uncommitted %v, expected %v", c.name, uncommitted, c.wantUncommitted)
+		}
+		if untracked != c.wantUntracked {
+			t.Errorf("%s: Exec returned untracked %v, expected %v", c.name, untracked, c.wantUntracked)
+		}
+	}
+}
+
 var (
 	TestVCSCmd = &vcs.Cmd{
 		Name:        "Test",
@@ -386,3 +620,132 @@ func TestLocalVCS(t *testing.T) {
 		t.Errorf("Error setting rev to testrev: %s", err.Error())
 	}
 }
+
+func TestVCSStatusEndToEnd(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-status-e2e")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+
+	expectedTime := "2020-01-02T15:04:05+00:00"
+	RevCmds[TestRevCmd.Name] = TestRevCmd
+	TimeCmds[TestRevCmd.Name] = &VCSCmd{
+		Name:       "Test",
+		Cmd:        "echo",
+		Args:       []string{expectedTime},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	}
+	StatusCmds[TestRevCmd.Name] = &StatusCmd{
+		Name:        "Test",
+		Cmd:         "echo",
+		Args:        []string{" M modified.go\n?? newfile.go"},
+		Untracked:   regexp.MustCompile(`^\?\? `),
+		Uncommitted: regexp.MustCompile(`.`),
+	}
+	defer func() {
+		delete(TimeCmds, TestRevCmd.Name)
+		delete(StatusCmds, TestRevCmd.Name)
+	}()
+
+	pkgname := "test.com/statustest"
+	if err := os.MkdirAll(PackageSource(testHome, pkgname), 0755); err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+
+	checkStatus := func(name string, status *VCSStatus, err error) {
+		if err != nil {
+			t.Fatalf("%s: Status returned error: %s", name, err.Error())
+		}
+		if status.Revision != expectedRev {
+			t.Errorf("%s: Status returned revision %s, expected %s", name, status.Revision, expectedRev)
+		}
+		if status.CommitTime != expectedTime {
+			t.Errorf("%s: Status returned commit time %s, expected %s", name, status.CommitTime, expectedTime)
+		}
+		if !status.Uncommitted {
+			t.Errorf("%s: Status did not report uncommitted changes", name)
+		}
+		if !status.Untracked {
+			t.Errorf("%s: Status did not report untracked files", name)
+		}
+	}
+
+	lv := NewLocalVCS(pkgname, pkgname, testHome, TestVCSCmd)
+	status, err := lv.Status()
+	checkStatus("LocalVCS", status, err)
+
+	pv := &PackageVCS{
+		Repo:   &vcs.RepoRoot{VCS: TestVCSCmd, Repo: "test", Root: pkgname},
+		GoPath: testHome,
+	}
+	status, err = pv.Status()
+	checkStatus("PackageVCS", status, err)
+}
+
+func TestCaptureDependency(t *testing.T) {
+	clean := &TestVCS{Rev: "abc123"}
+	dep, err := CaptureDependency("testi", "git@github.com:Comcast/Canticle.git", clean, false)
+	if err != nil {
+		t.Fatalf("CaptureDependency returned error for a clean tree: %s", err.Error())
+	}
+	if dep.Revision != "abc123" {
+		t.Errorf("CaptureDependency did not record revision, got %s", dep.Revision)
+	}
+
+	dirty := &TestVCS{
+		Rev:          "abc123",
+		StatusResult: &VCSStatus{Revision: "abc123", Uncommitted: true},
+	}
+	if _, err := CaptureDependency("testi", "git@github.com:Comcast/Canticle.git", dirty, false); err != ErrDirtyWorkingTree {
+		t.Errorf("CaptureDependency did not refuse a dirty tree, got err %v", err)
+	}
+	if _, err := CaptureDependency("testi", "git@github.com:Comcast/Canticle.git", dirty, true); err != nil {
+		t.Errorf("CaptureDependency with allowDirty returned error: %s", err.Error())
+	}
+}
+
+func TestReadWriteDependencyFile(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-deps")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+
+	depFile := path.Join(testHome, DependencyFile)
+
+	deps, err := ReadDependencyFile(depFile)
+	if err != nil {
+		t.Fatalf("ReadDependencyFile returned error for a missing file: %s", err.Error())
+	}
+	if len(deps) != 0 {
+		t.Errorf("ReadDependencyFile returned %d deps for a missing file, expected 0", len(deps))
+	}
+
+	deps = Dependencies{
+		"github.com/Comcast/Canticle": &CanticleDependency{
+			Root:        "github.com/Comcast/Canticle",
+			SourcePaths: []string{"git@github.com:Comcast/Canticle.git", "https://github.com/Comcast/Canticle.git"},
+			Revision:    "abc123",
+			CommitTime:  "2020-01-02T15:04:05+00:00",
+		},
+	}
+	if err := WriteDependencyFile(depFile, deps); err != nil {
+		t.Fatalf("WriteDependencyFile returned error: %s", err.Error())
+	}
+
+	loaded, err := ReadDependencyFile(depFile)
+	if err != nil {
+		t.Fatalf("ReadDependencyFile returned error after a write: %s", err.Error())
+	}
+	if !reflect.DeepEqual(deps, loaded) {
+		t.Errorf("ReadDependencyFile did not round trip, got %+v, expected %+v", loaded, deps)
+	}
+
+	if err := ioutil.WriteFile(depFile, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Error writing malformed dependency file: %s", err.Error())
+	}
+	if _, err := ReadDependencyFile(depFile); err == nil {
+		t.Errorf("ReadDependencyFile did not return an error for malformed JSON")
+	}
+}
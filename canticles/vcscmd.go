@@ -0,0 +1,203 @@
+package canticles
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// VCSCmd describes a single command Canticle can run against a local
+// checkout to extract a piece of information about it (the current
+// revision, the commit time, the source URL, ...). The command's
+// combined output is matched against ParseRegex and the first submatch is
+// returned as the result.
+type VCSCmd struct {
+	// Name identifies the underlying VCS this command applies to, and
+	// matches the Name of the golang.org/x/tools/go/vcs.Cmd it is paired
+	// with (e.g. "Git", "Mercurial").
+	Name       string
+	Cmd        string
+	Args       []string
+	ParseRegex *regexp.Regexp
+}
+
+// Exec runs the command in dir, returning the first submatch ParseRegex
+// finds in its (trimmed) combined output. It is an error for the command to
+// fail or for its output not to match ParseRegex.
+func (v *VCSCmd) Exec(dir string) (string, error) {
+	cmd := exec.Command(v.Cmd, v.Args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("canticles: %s command %q failed: %s: %s", v.Name, v.Cmd, err, out)
+	}
+	matches := v.ParseRegex.FindStringSubmatch(strings.TrimSpace(string(out)))
+	if matches == nil {
+		return "", fmt.Errorf("canticles: %s command %q output %q did not match expected pattern", v.Name, v.Cmd, out)
+	}
+	return matches[1], nil
+}
+
+// StatusCmd runs a VCS's status command and classifies each line of its
+// output as indicating an untracked file, an uncommitted change, or
+// neither, so LocalVCS and PackageVCS can report VCSStatus without needing
+// a single-value ParseRegex the way VCSCmd does.
+type StatusCmd struct {
+	Name        string
+	Cmd         string
+	Args        []string
+	Untracked   *regexp.Regexp
+	Uncommitted *regexp.Regexp
+}
+
+// Exec runs the status command in dir and reports whether the working
+// tree has uncommitted changes and/or untracked files.
+func (s *StatusCmd) Exec(dir string) (uncommitted, untracked bool, err error) {
+	cmd := exec.Command(s.Cmd, s.Args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, false, fmt.Errorf("canticles: %s command %q failed: %s: %s", s.Name, s.Cmd, err, out)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if s.Untracked != nil && s.Untracked.MatchString(line) {
+			untracked = true
+			continue
+		}
+		if s.Uncommitted != nil && s.Uncommitted.MatchString(line) {
+			uncommitted = true
+		}
+	}
+	return uncommitted, untracked, nil
+}
+
+// TimeCmds maps a VCS Name to the command used to read the commit time of
+// the revision currently checked out locally, formatted as RFC3339
+// (git: log -1 --format=%cI, and analogous for hg/bzr/svn). Bazaar's
+// "log --line" output carries only the commit date, so its entry yields a
+// YYYY-MM-DD date with no time of day.
+var TimeCmds = map[string]*VCSCmd{
+	"Git": {
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"log", "-1", "--format=%cI"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Mercurial": {
+		Name:       "Mercurial",
+		Cmd:        "hg",
+		Args:       []string{"log", "-l", "1", "--template", "{date|rfc3339date}"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Bazaar": {
+		Name:       "Bazaar",
+		Cmd:        "bzr",
+		Args:       []string{"log", "-l", "1", "--line"},
+		ParseRegex: regexp.MustCompile(`^\d+:.*?(\d{4}-\d{2}-\d{2})`),
+	},
+	"Subversion": {
+		Name:       "Subversion",
+		Cmd:        "svn",
+		Args:       []string{"info", "--show-item", "last-changed-date"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+}
+
+// StatusCmds maps a VCS Name to the command used to detect uncommitted
+// changes and untracked files in a local checkout.
+var StatusCmds = map[string]*StatusCmd{
+	"Git": {
+		Name:        "Git",
+		Cmd:         "git",
+		Args:        []string{"status", "--porcelain"},
+		Untracked:   regexp.MustCompile(`^\?\? `),
+		Uncommitted: regexp.MustCompile(`.`),
+	},
+	"Mercurial": {
+		Name:        "Mercurial",
+		Cmd:         "hg",
+		Args:        []string{"status"},
+		Untracked:   regexp.MustCompile(`^\? `),
+		Uncommitted: regexp.MustCompile(`.`),
+	},
+	"Bazaar": {
+		Name:        "Bazaar",
+		Cmd:         "bzr",
+		Args:        []string{"status", "--short"},
+		Untracked:   regexp.MustCompile(`^\?\s`),
+		Uncommitted: regexp.MustCompile(`.`),
+	},
+	"Subversion": {
+		Name:        "Subversion",
+		Cmd:         "svn",
+		Args:        []string{"status"},
+		Untracked:   regexp.MustCompile(`^\?\s`),
+		Uncommitted: regexp.MustCompile(`.`),
+	},
+}
+
+// SourceCmds maps a VCS Name to the command used to read the source URL a
+// local checkout was cloned from.
+var SourceCmds = map[string]*VCSCmd{
+	"Git": {
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"config", "--get", "remote.origin.url"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Mercurial": {
+		Name:       "Mercurial",
+		Cmd:        "hg",
+		Args:       []string{"paths", "default"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Bazaar": {
+		Name:       "Bazaar",
+		Cmd:        "bzr",
+		Args:       []string{"info"},
+		ParseRegex: regexp.MustCompile(`parent branch:\s*(\S+)`),
+	},
+	"Subversion": {
+		Name:       "Subversion",
+		Cmd:        "svn",
+		Args:       []string{"info", "--show-item", "url"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+}
+
+// RevCmds maps a VCS Name (as reported by golang.org/x/tools/go/vcs.Cmd) to
+// the command used to read the current revision of a local checkout. A VCS
+// with no entry here is treated as supporting no revision lookup; callers
+// should tolerate a missing entry rather than treating it as an error, so
+// that VCS types Canticle doesn't know how to introspect still work for
+// checkout/create/sync operations.
+var RevCmds = map[string]*VCSCmd{
+	"Git": {
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"rev-parse", "HEAD"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Mercurial": {
+		Name:       "Mercurial",
+		Cmd:        "hg",
+		Args:       []string{"identify", "--id"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Bazaar": {
+		Name:       "Bazaar",
+		Cmd:        "bzr",
+		Args:       []string{"revno"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+	"Subversion": {
+		Name:       "Subversion",
+		Cmd:        "svn",
+		Args:       []string{"info", "--show-item", "revision"},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+	},
+}